@@ -0,0 +1,63 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fission/fission/executor/fscache"
+)
+
+// Backend is implemented by each function execution strategy (poolmgr,
+// deploymgr, ...). Executor routes a specialization request to the Backend
+// that matches the function's ExecutorType instead of hard-coding a single
+// process-wide strategy. Backends are built through the registry in
+// registry.go rather than constructed directly, so a community backend
+// (e.g. KNative, Firecracker) can be added without editing this package.
+type Backend interface {
+	// Start prepares the backend to serve specialization requests --
+	// e.g. cleaning up resources left behind by a previous instance of
+	// the executor. It's called once, before the backend handles any
+	// request.
+	Start(ctx context.Context) error
+
+	// Stop releases whatever background resources Start acquired.
+	Stop(ctx context.Context) error
+
+	// HealthCheck reports whether the backend is currently able to
+	// specialize functions.
+	HealthCheck(ctx context.Context) error
+
+	// GetFuncSvc returns a FuncSvc for the given function, specializing
+	// one if none is already running for it. logger is a child logger
+	// already tagged with the request's correlation ID. Implementations
+	// should check ctx between steps of a multi-step specialization (and
+	// pass it down to any polling they do) so that sfGroup cancelling an
+	// attempt that ran past its timeout actually stops the backend's
+	// work, instead of merely releasing callers waiting on the result.
+	GetFuncSvc(ctx context.Context, logger hclog.Logger, m *metav1.ObjectMeta) (*fscache.FuncSvc, error)
+
+	// TapService notifies the backend that fsvc was just served a
+	// request, so it can keep the backing resources warm.
+	TapService(fsvc *fscache.FuncSvc) error
+
+	// Cleanup tears down whatever resources the backend created for fsvc.
+	Cleanup(fsvc *fscache.FuncSvc) error
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/fission/fission"
+)
+
+// defaultExecutorConfigPath is where StartExecutor looks for the backend
+// config file unless EXECUTOR_CONFIG_PATH overrides it.
+const defaultExecutorConfigPath = "/etc/fission/executor.yaml"
+
+// ExecutorConfig is the top-level shape of executor.yaml: which backends
+// are enabled and what ExecutorType/params each one runs under.
+type ExecutorConfig struct {
+	Backends []BackendConfig `yaml:"backends"`
+}
+
+// executorConfigPath reads EXECUTOR_CONFIG_PATH; an unset value falls back
+// to defaultExecutorConfigPath.
+func executorConfigPath() string {
+	if v := os.Getenv("EXECUTOR_CONFIG_PATH"); v != "" {
+		return v
+	}
+	return defaultExecutorConfigPath
+}
+
+// defaultExecutorConfig preserves the executor's long-standing behaviour --
+// both built-in backends enabled, routed by their usual ExecutorType -- for
+// deployments that don't ship an executor.yaml.
+func defaultExecutorConfig() *ExecutorConfig {
+	return &ExecutorConfig{
+		Backends: []BackendConfig{
+			{Name: "poolmgr", ExecutorType: string(fission.ExecutorTypePoolmgr), Enabled: true},
+			{Name: "deploy", ExecutorType: string(fission.ExecutorTypeNewdeploy), Enabled: true},
+		},
+	}
+}
+
+// loadExecutorConfig reads and parses path. A missing file is expected --
+// most deployments don't need to customize the backend set -- and falls
+// back to defaultExecutorConfig(); a present-but-invalid file is logged and
+// also falls back, rather than failing the executor's startup outright.
+func loadExecutorConfig(logger hclog.Logger, path string) *ExecutorConfig {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("error reading executor config, using defaults", "path", path, "error", err)
+		}
+		return defaultExecutorConfig()
+	}
+
+	var cfg ExecutorConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		logger.Warn("error parsing executor config, using defaults", "path", path, "error", err)
+		return defaultExecutorConfig()
+	}
+	if len(cfg.Backends) == 0 {
+		return defaultExecutorConfig()
+	}
+	return &cfg
+}
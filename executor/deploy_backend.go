@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-hclog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fission/fission/executor/deploymgr"
+	"github.com/fission/fission/executor/fscache"
+)
+
+func init() {
+	Register("deploy", newDeployBackend)
+}
+
+// newDeployBackend is the BackendFactory registered under the name
+// "deploy".
+func newDeployBackend(logger hclog.Logger, deps BackendDeps, cfg BackendConfig) (Backend, error) {
+	dm := deploymgr.MakeDeploymentManager(
+		logger, deps.FissionClient, deps.KubernetesClient, deps.DynamicClient,
+		deps.FunctionNamespace, deps.FsCache, deps.InstanceID)
+
+	return &deployBackend{
+		dm:     dm,
+		envRes: deps.EnvRes,
+	}, nil
+}
+
+// deployBackend adapts deploymgr.DeploymentManager to the Backend
+// interface. deploymgr needs the function's Environment up front (to know
+// which image to run), so this adapter resolves it before delegating.
+type deployBackend struct {
+	dm     *deploymgr.DeploymentManager
+	envRes *envResolver
+}
+
+func (b *deployBackend) Start(ctx context.Context) error {
+	return nil
+}
+
+func (b *deployBackend) Stop(ctx context.Context) error {
+	return nil
+}
+
+func (b *deployBackend) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (b *deployBackend) GetFuncSvc(ctx context.Context, logger hclog.Logger, m *metav1.ObjectMeta) (*fscache.FuncSvc, error) {
+	env, err := b.envRes.getFunctionEnv(logger, m)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("getting function service from deployment")
+	return b.dm.GetFuncSvc(ctx, m, env)
+}
+
+func (b *deployBackend) TapService(fsvc *fscache.FuncSvc) error {
+	return b.dm.TapService(fsvc)
+}
+
+func (b *deployBackend) Cleanup(fsvc *fscache.FuncSvc) error {
+	return b.dm.Cleanup(fsvc)
+}
@@ -0,0 +1,225 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package deploymgr is the DEPLOY backend: it materializes a function as a
+// long-lived Kubernetes Deployment + Service (and, optionally, an HPA),
+// rather than borrowing a warm pod from a generic pool. It's meant for
+// functions that don't fit the cold-pool model -- large images, warm
+// concurrency > 1, or GPU requirements.
+package deploymgr
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	appsv1 "k8s.io/api/apps/v1"
+	k8sErrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fission/fission/crd"
+	"github.com/fission/fission/executor/fscache"
+)
+
+// readinessPollInterval is how often we poll a freshly applied Deployment
+// while waiting for it to become ready.
+const readinessPollInterval = 500 * time.Millisecond
+
+// DeploymentManager creates and tears down per-function Deployments and
+// Services, and keeps fsCache in sync with them.
+type DeploymentManager struct {
+	logger            hclog.Logger
+	kubernetesClient  *kubernetes.Clientset
+	dynamicClient     dynamic.Interface
+	fissionClient     *crd.FissionClient
+	fsCache           *fscache.FunctionServiceCache
+	functionNamespace string
+	instanceID        string
+
+	// readyTimeout bounds how long GetFuncSvc waits for a freshly
+	// applied Deployment to report Ready before giving up.
+	readyTimeout time.Duration
+}
+
+// MakeDeploymentManager builds a DeploymentManager. It mirrors
+// poolmgr.MakeGenericPoolManager's constructor shape so the two backends can
+// be wired up the same way from StartExecutor.
+func MakeDeploymentManager(logger hclog.Logger, fissionClient *crd.FissionClient, kubernetesClient *kubernetes.Clientset,
+	dynamicClient dynamic.Interface, functionNamespace string, fsCache *fscache.FunctionServiceCache,
+	instanceID string) *DeploymentManager {
+
+	return &DeploymentManager{
+		logger:            logger.Named("deploymgr"),
+		kubernetesClient:  kubernetesClient,
+		dynamicClient:     dynamicClient,
+		fissionClient:     fissionClient,
+		fsCache:           fsCache,
+		functionNamespace: functionNamespace,
+		instanceID:        instanceID,
+		readyTimeout:      2 * time.Minute,
+	}
+}
+
+// GetFuncSvc returns the FuncSvc backing m's Deployment, creating it (and
+// the Service/HPA in front of it) if it doesn't already exist. ctx is
+// checked between each step of that multi-step create, and while waiting
+// for the Deployment to become ready, so a singleflight timeout or a
+// disconnected caller actually aborts the attempt instead of only
+// releasing whoever was waiting on its result.
+func (dm *DeploymentManager) GetFuncSvc(ctx context.Context, m *metav1.ObjectMeta, env *crd.Environment) (*fscache.FuncSvc, error) {
+	fsvc, err := dm.fsCache.GetByFunction(m)
+	if err == nil {
+		return fsvc, nil
+	}
+
+	dm.logger.Info("no cached deployment found, creating one", "function", m.Name)
+
+	f, err := dm.fissionClient.Functions(m.Namespace).Get(m.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	objName := uniqueDeployName(m)
+
+	// Owned resources are applied in a fixed order: anything the pod
+	// mounts (ConfigMap/Secret references) goes in before the workload
+	// that consumes it, and the Service goes in last so it never routes
+	// to a Deployment that doesn't exist yet. ctx.Err() is checked
+	// between steps since the individual k8s client calls below don't
+	// themselves take a context to cancel against.
+	if err := dm.applyConfigAndSecrets(objName, f); err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		dm.teardown(objName)
+		return nil, ctx.Err()
+	}
+	dep, err := dm.applyDeployment(objName, m, f, env)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		dm.teardown(objName)
+		return nil, ctx.Err()
+	}
+	svc, err := dm.applyService(objName, m)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		dm.teardown(objName)
+		return nil, ctx.Err()
+	}
+	if err := dm.applyHpaIfRequested(objName, f); err != nil {
+		return nil, err
+	}
+
+	if err := dm.waitForReady(ctx, dep); err != nil {
+		// best-effort teardown of the partially-applied resources
+		dm.teardown(objName)
+		return nil, err
+	}
+
+	newFsvc := &fscache.FuncSvc{
+		Function:    m,
+		Environment: env,
+		Address:     fmt.Sprintf("%v.%v", svc.Name, svc.Namespace),
+		Ctime:       time.Now(),
+		Atime:       time.Now(),
+	}
+	dm.fsCache.Add(newFsvc)
+
+	return newFsvc, nil
+}
+
+// TapService bumps fsvc's last-accessed time so idle-Deployment GC (run out
+// of band, the same way poolmgr ages out idle pods) leaves it alone.
+func (dm *DeploymentManager) TapService(fsvc *fscache.FuncSvc) error {
+	dm.fsCache.TouchByAddress(fsvc.Address)
+	return nil
+}
+
+// Cleanup tears down the Deployment, Service, HPA and any ConfigMap/Secret
+// this manager created for fsvc, in the reverse of their creation order.
+func (dm *DeploymentManager) Cleanup(fsvc *fscache.FuncSvc) error {
+	objName := uniqueDeployName(fsvc.Function)
+	dm.teardown(objName)
+	dm.fsCache.DeleteByAddress(fsvc.Address)
+	return nil
+}
+
+// teardown removes owned resources in reverse install order: HPA, Service,
+// Deployment, then ConfigMap/Secret. Missing resources are not an error --
+// Cleanup can be called on a partially-created set.
+func (dm *DeploymentManager) teardown(objName string) {
+	deleteOpts := &metav1.DeleteOptions{}
+
+	if err := dm.kubernetesClient.AutoscalingV1().HorizontalPodAutoscalers(dm.functionNamespace).
+		Delete(objName, deleteOpts); err != nil && !k8sErrs.IsNotFound(err) {
+		dm.logger.Error("error deleting HPA", "name", objName, "error", err)
+	}
+	if err := dm.kubernetesClient.CoreV1().Services(dm.functionNamespace).
+		Delete(objName, deleteOpts); err != nil && !k8sErrs.IsNotFound(err) {
+		dm.logger.Error("error deleting service", "name", objName, "error", err)
+	}
+	if err := dm.kubernetesClient.AppsV1().Deployments(dm.functionNamespace).
+		Delete(objName, deleteOpts); err != nil && !k8sErrs.IsNotFound(err) {
+		dm.logger.Error("error deleting deployment", "name", objName, "error", err)
+	}
+	if err := dm.kubernetesClient.CoreV1().ConfigMaps(dm.functionNamespace).
+		Delete(objName, deleteOpts); err != nil && !k8sErrs.IsNotFound(err) {
+		dm.logger.Error("error deleting configmap", "name", objName, "error", err)
+	}
+	if err := dm.kubernetesClient.CoreV1().Secrets(dm.functionNamespace).
+		Delete(objName, deleteOpts); err != nil && !k8sErrs.IsNotFound(err) {
+		dm.logger.Error("error deleting secret", "name", objName, "error", err)
+	}
+}
+
+// waitForReady polls dep until its observed generation has rolled out and
+// all replicas are ready, until readyTimeout elapses, or until ctx is
+// cancelled -- whichever comes first.
+func (dm *DeploymentManager) waitForReady(ctx context.Context, dep *appsv1.Deployment) error {
+	deadline := time.Now().Add(dm.readyTimeout)
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		d, err := dm.kubernetesClient.AppsV1().Deployments(dep.Namespace).Get(dep.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if d.Status.ObservedGeneration >= d.Generation && d.Status.UpdatedReplicas == *d.Spec.Replicas &&
+			d.Status.ReadyReplicas == *d.Spec.Replicas {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(readinessPollInterval):
+		}
+	}
+	return fmt.Errorf("deployment %v/%v did not become ready within %v", dep.Namespace, dep.Name, dm.readyTimeout)
+}
+
+func uniqueDeployName(m *metav1.ObjectMeta) string {
+	return fmt.Sprintf("%v-%v", m.Name, crd.CacheKey(m))
+}
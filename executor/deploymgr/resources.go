@@ -0,0 +1,307 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deploymgr
+
+import (
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/fission/fission/crd"
+)
+
+const (
+	fieldManager = "fission-deploymgr"
+)
+
+// applyConfigAndSecrets server-side applies a ConfigMap/Secret mirroring
+// the data of every ConfigMap/Secret the function references, if any.
+// It's a no-op for functions that don't mount config -- most functions
+// don't.
+func (dm *DeploymentManager) applyConfigAndSecrets(objName string, f *crd.Function) error {
+	if len(f.Spec.ConfigMaps) == 0 && len(f.Spec.Secrets) == 0 {
+		return nil
+	}
+
+	if len(f.Spec.ConfigMaps) > 0 {
+		data, err := dm.mergedConfigMapData(f)
+		if err != nil {
+			return err
+		}
+
+		// The referenced ConfigMaps' data is mirrored under objName so
+		// the Deployment can mount a single, stably-named volume
+		// regardless of how many references the function has.
+		cm := &apiv1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objName,
+				Namespace: dm.functionNamespace,
+				Labels:    dm.labels(objName),
+			},
+			Data: data,
+		}
+		if err := dm.serverSideApply(cm, schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}); err != nil {
+			return err
+		}
+	}
+
+	if len(f.Spec.Secrets) > 0 {
+		data, err := dm.mergedSecretData(f)
+		if err != nil {
+			return err
+		}
+
+		secret := &apiv1.Secret{
+			TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      objName,
+				Namespace: dm.functionNamespace,
+				Labels:    dm.labels(objName),
+			},
+			Data: data,
+		}
+		if err := dm.serverSideApply(secret, schema.GroupVersionResource{Version: "v1", Resource: "secrets"}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergedConfigMapData reads every ConfigMap f.Spec.ConfigMaps references
+// and merges their Data into one map, keyed by the original keys, for
+// applyConfigAndSecrets to mirror under objName.
+func (dm *DeploymentManager) mergedConfigMapData(f *crd.Function) (map[string]string, error) {
+	data := make(map[string]string)
+	for _, ref := range f.Spec.ConfigMaps {
+		cm, err := dm.kubernetesClient.CoreV1().ConfigMaps(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error reading configmap %v/%v: %v", ref.Namespace, ref.Name, err)
+		}
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
+
+// mergedSecretData reads every Secret f.Spec.Secrets references and
+// merges their Data into one map, for applyConfigAndSecrets to mirror
+// under objName.
+func (dm *DeploymentManager) mergedSecretData(f *crd.Function) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	for _, ref := range f.Spec.Secrets {
+		secret, err := dm.kubernetesClient.CoreV1().Secrets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("error reading secret %v/%v: %v", ref.Namespace, ref.Name, err)
+		}
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+	}
+	return data, nil
+}
+
+// applyDeployment server-side applies the Deployment that runs env's image
+// for function f, and returns the applied object.
+func (dm *DeploymentManager) applyDeployment(objName string, m *metav1.ObjectMeta, f *crd.Function, env *crd.Environment) (*appsv1.Deployment, error) {
+	replicas := int32(1)
+	if minScale := f.Spec.InvokeStrategy.ExecutionStrategy.MinScale; minScale > 0 {
+		replicas = int32(minScale)
+	}
+
+	container := apiv1.Container{
+		Name:  "fission-function",
+		Image: env.Spec.Runtime.Image,
+		Ports: []apiv1.ContainerPort{{Name: "http-env", ContainerPort: 8888}},
+	}
+
+	// Mount the ConfigMap/Secret applyConfigAndSecrets mirrored under
+	// objName, if the function referenced any.
+	var volumes []apiv1.Volume
+	if len(f.Spec.ConfigMaps) > 0 {
+		container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+			Name: "configs", MountPath: "/configs", ReadOnly: true,
+		})
+		volumes = append(volumes, apiv1.Volume{
+			Name: "configs",
+			VolumeSource: apiv1.VolumeSource{
+				ConfigMap: &apiv1.ConfigMapVolumeSource{LocalObjectReference: apiv1.LocalObjectReference{Name: objName}},
+			},
+		})
+	}
+	if len(f.Spec.Secrets) > 0 {
+		container.VolumeMounts = append(container.VolumeMounts, apiv1.VolumeMount{
+			Name: "secrets", MountPath: "/secrets", ReadOnly: true,
+		})
+		volumes = append(volumes, apiv1.Volume{
+			Name:         "secrets",
+			VolumeSource: apiv1.VolumeSource{Secret: &apiv1.SecretVolumeSource{SecretName: objName}},
+		})
+	}
+
+	dep := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{Kind: "Deployment", APIVersion: "apps/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      objName,
+			Namespace: dm.functionNamespace,
+			Labels:    dm.labels(objName),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: dm.selectorLabels(objName)},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: dm.selectorLabels(objName)},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{container},
+					Volumes:    volumes,
+				},
+			},
+		},
+	}
+
+	if err := dm.serverSideApply(dep, schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}); err != nil {
+		return nil, err
+	}
+	return dm.kubernetesClient.AppsV1().Deployments(dm.functionNamespace).Get(objName, metav1.GetOptions{})
+}
+
+// applyService server-side applies the ClusterIP Service that fronts
+// objName's Deployment, and returns the applied object.
+func (dm *DeploymentManager) applyService(objName string, m *metav1.ObjectMeta) (*apiv1.Service, error) {
+	svc := &apiv1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      objName,
+			Namespace: dm.functionNamespace,
+			Labels:    dm.labels(objName),
+		},
+		Spec: apiv1.ServiceSpec{
+			Selector: dm.selectorLabels(objName),
+			Ports: []apiv1.ServicePort{
+				{Name: "http-env", Port: 80, TargetPort: intstr.FromInt(8888)},
+			},
+		},
+	}
+
+	if err := dm.serverSideApply(svc, schema.GroupVersionResource{Version: "v1", Resource: "services"}); err != nil {
+		return nil, err
+	}
+	return dm.kubernetesClient.CoreV1().Services(dm.functionNamespace).Get(objName, metav1.GetOptions{})
+}
+
+// applyHpaIfRequested server-side applies an HPA for objName when f's
+// execution strategy sets MaxScale above MinScale.
+func (dm *DeploymentManager) applyHpaIfRequested(objName string, f *crd.Function) error {
+	strategy := f.Spec.InvokeStrategy.ExecutionStrategy
+	if strategy.MaxScale <= strategy.MinScale {
+		return nil
+	}
+
+	minReplicas := int32(strategy.MinScale)
+	targetCPU := strategy.TargetCPUPercent
+	if targetCPU <= 0 {
+		targetCPU = 80
+	}
+
+	hpa := &autoscalingv1.HorizontalPodAutoscaler{
+		TypeMeta: metav1.TypeMeta{Kind: "HorizontalPodAutoscaler", APIVersion: "autoscaling/v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      objName,
+			Namespace: dm.functionNamespace,
+			Labels:    dm.labels(objName),
+		},
+		Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{
+				Kind:       "Deployment",
+				Name:       objName,
+				APIVersion: "apps/v1",
+			},
+			MinReplicas:                    &minReplicas,
+			MaxReplicas:                    int32(strategy.MaxScale),
+			TargetCPUUtilizationPercentage: &targetCPU,
+		},
+	}
+
+	return dm.serverSideApply(hpa, schema.GroupVersionResource{Group: "autoscaling", Version: "v1", Resource: "horizontalpodautoscalers"})
+}
+
+// serverSideApply applies obj via the dynamic client's Apply verb, using
+// the fixed fieldManager name as the field manager. Applying through the
+// dynamic client (rather than typed Update calls) lets fission and other
+// controllers/users co-own fields on the same object without clobbering
+// each other. Callers must set obj's TypeMeta (Kind/APIVersion) -- those
+// fields are `json:",omitempty"` on the typed structs, so a server-side
+// apply patch built from one with a zero TypeMeta would omit
+// apiVersion/kind entirely and the API server would reject it.
+func (dm *DeploymentManager) serverSideApply(obj runtime.Object, gvr schema.GroupVersionResource) error {
+	accessor, ok := obj.(metav1.Object)
+	if !ok {
+		return nil
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(&unstructured.Unstructured{Object: u})
+	if err != nil {
+		return err
+	}
+
+	force := true
+	_, err = dm.dynamicClient.Resource(gvr).Namespace(dm.functionNamespace).
+		Patch(accessor.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	return err
+}
+
+// selectorLabels returns the label set that identifies objName's pods --
+// used as the Deployment's Spec.Selector, the Service's Spec.Selector,
+// and the pod template's own labels, all of which must agree with each
+// other. Spec.Selector is immutable on a Deployment once created, so this
+// must stay stable across executor restarts: it deliberately excludes
+// dm.instanceID, which is a fresh random string generated every time
+// StartExecutor runs -- baking it in here would make GetFuncSvc fail
+// permanently on every pre-existing DEPLOY function after a restart,
+// since the re-applied selector would no longer match the live object's.
+func (dm *DeploymentManager) selectorLabels(objName string) map[string]string {
+	return map[string]string{
+		"fission-function-deployment": objName,
+		"executorType":                "deploy",
+	}
+}
+
+// labels returns selectorLabels(objName) plus ownership metadata that's
+// only safe on fields Kubernetes allows to change freely, e.g. a
+// Deployment/Service/ConfigMap/Secret/HPA's own ObjectMeta.Labels --
+// never on a Spec.Selector or a pod template's labels.
+func (dm *DeploymentManager) labels(objName string) map[string]string {
+	labels := dm.selectorLabels(objName)
+	labels["managedBy"] = "fission-deploymgr"
+	labels["fission-instanceID"] = dm.instanceID
+	return labels
+}
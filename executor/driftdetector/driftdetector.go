@@ -0,0 +1,273 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package driftdetector reconciles fsCache against what's actually running
+// in the cluster. Executor otherwise trusts fsCache blindly: if a
+// specialized pod is evicted, OOM-killed, or deleted out-of-band, the
+// cached FuncSvc keeps pointing at a dead address and the router 502s
+// until the entry ages out on its own.
+package driftdetector
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fission/fission/executor/fscache"
+	"github.com/fission/fission/executor/svcaddr"
+)
+
+// DefaultInterval is how often the reconciliation loop runs when the
+// caller doesn't ask for a specific interval.
+const DefaultInterval = 30 * time.Second
+
+// PoolReclaimer is the subset of poolmgr's GenericPoolManager that
+// DriftDetector needs: a way to hand a slot back to the pool once its
+// FuncSvc has been evicted. Defined locally to avoid an import cycle
+// between driftdetector and poolmgr.
+type PoolReclaimer interface {
+	ReclaimSlot(fsvc *fscache.FuncSvc) error
+}
+
+// funcCache is the subset of fscache.FunctionServiceCache DriftDetector
+// needs. Defined locally, same as PoolReclaimer, so tests can exercise
+// reconcileOnce/evict against a fake instead of the real cache.
+type funcCache interface {
+	ListAll() []*fscache.FuncSvc
+	DeleteByAddress(address string)
+}
+
+// Stats is a point-in-time snapshot of the detector's reconciliation
+// counters, returned by the /v1/drift debug endpoint.
+type Stats struct {
+	Checked int       `json:"checked"`
+	Drifted int       `json:"drifted"`
+	Evicted int       `json:"evicted"`
+	LastRun time.Time `json:"lastRun"`
+}
+
+// DriftDetector periodically compares fsCache entries against the pods and
+// services actually backing them.
+type DriftDetector struct {
+	logger      hclog.Logger
+	fsCache     funcCache
+	reclaimer   PoolReclaimer
+	namespace   string
+	interval    time.Duration
+	podInformer cache.SharedIndexInformer
+	svcInformer cache.SharedIndexInformer
+
+	statsLock sync.RWMutex
+	stats     Stats
+}
+
+// MakeDriftDetector builds a DriftDetector that watches functionNamespace
+// pods through kubernetesClient's shared informers -- list-and-diff
+// against each fsCache entry doesn't scale past a few hundred functions,
+// an informer does.
+func MakeDriftDetector(logger hclog.Logger, kubernetesClient *kubernetes.Clientset, fsCache *fscache.FunctionServiceCache,
+	reclaimer PoolReclaimer, namespace string, interval time.Duration) *DriftDetector {
+
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(kubernetesClient, interval,
+		informers.WithNamespace(namespace))
+
+	return &DriftDetector{
+		logger:      logger.Named("driftdetector"),
+		fsCache:     fsCache,
+		reclaimer:   reclaimer,
+		namespace:   namespace,
+		interval:    interval,
+		podInformer: factory.Core().V1().Pods().Informer(),
+		svcInformer: factory.Core().V1().Services().Informer(),
+	}
+}
+
+// Run starts the pod/service informers and the periodic reconciliation
+// loop. It blocks until stopCh is closed, so callers should invoke it in
+// its own goroutine, the same way StartExecutor launches
+// Executor.serveCreateFuncServices.
+func (d *DriftDetector) Run(stopCh <-chan struct{}) {
+	go d.podInformer.Run(stopCh)
+	go d.svcInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, d.podInformer.HasSynced, d.svcInformer.HasSynced) {
+		d.logger.Error("informer cache failed to sync")
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			d.reconcileOnce()
+		}
+	}
+}
+
+// reconcileOnce walks every cached FuncSvc, compares its recorded state
+// against the informers' current view, and refreshes or evicts the entry
+// on drift.
+func (d *DriftDetector) reconcileOnce() {
+	checked, drifted, evicted := 0, 0, 0
+
+	for _, fsvc := range d.fsCache.ListAll() {
+		checked++
+
+		// A poolmgr-backed FuncSvc records the single pod it was
+		// specialized onto. A deploy-backed one never sets PodName --
+		// its Address names a stable Service instead, fronting
+		// however many pods the Deployment currently has -- so it
+		// needs the Service's selector to find its backing pods,
+		// same as logstream.backingPods does for log streaming.
+		if fsvc.PodName != "" {
+			d.reconcileSinglePod(fsvc, &drifted, &evicted)
+		} else {
+			d.reconcileServiceBacked(fsvc, &drifted, &evicted)
+		}
+	}
+
+	d.statsLock.Lock()
+	d.stats = Stats{Checked: checked, Drifted: drifted, Evicted: evicted, LastRun: time.Now()}
+	d.statsLock.Unlock()
+}
+
+// reconcileSinglePod handles a poolmgr-backed entry, keyed by its one
+// specialized pod.
+func (d *DriftDetector) reconcileSinglePod(fsvc *fscache.FuncSvc, drifted, evicted *int) {
+	obj, exists, err := d.podInformer.GetStore().GetByKey(fmt.Sprintf("%v/%v", d.namespace, fsvc.PodName))
+	if err != nil {
+		d.logger.Error("error looking up pod", "address", fsvc.Address, "error", err)
+		return
+	}
+
+	if !exists {
+		// Pod is gone out-of-band -- the cached address is dead.
+		*drifted++
+		d.evict(fsvc)
+		*evicted++
+		return
+	}
+
+	pod := obj.(*apiv1.Pod)
+	if d.hasDrifted(fsvc, pod) {
+		// Running+Ready or not, the cached Address no longer matches
+		// the pod's IP, and fsCache has no call to update an existing
+		// entry's Address in place -- TouchByAddress only bumps the
+		// last-accessed time, it doesn't touch the value the router
+		// reads. Evicting and letting the next request re-specialize
+		// is the only way to actually get the new IP into the cache;
+		// touching here would just reset the stale entry's TTL
+		// instead of it aging out.
+		*drifted++
+		d.evict(fsvc)
+		*evicted++
+	}
+}
+
+// reconcileServiceBacked handles a deploy-backed entry, keyed by the
+// stable Service its Address names. It's drifted only once none of the
+// Service's currently-selected pods are Ready -- individual pod churn
+// behind a Deployment is expected and isn't drift.
+func (d *DriftDetector) reconcileServiceBacked(fsvc *fscache.FuncSvc, drifted, evicted *int) {
+	svcName, svcNamespace := svcaddr.Split(fsvc.Address, d.namespace)
+
+	obj, exists, err := d.svcInformer.GetStore().GetByKey(fmt.Sprintf("%v/%v", svcNamespace, svcName))
+	if err != nil {
+		d.logger.Error("error looking up service", "address", fsvc.Address, "error", err)
+		return
+	}
+	if !exists {
+		*drifted++
+		d.evict(fsvc)
+		*evicted++
+		return
+	}
+
+	svc := obj.(*apiv1.Service)
+	selector := labels.SelectorFromSet(svc.Spec.Selector)
+
+	for _, obj := range d.podInformer.GetStore().List() {
+		pod := obj.(*apiv1.Pod)
+		if pod.Namespace == svcNamespace && selector.Matches(labels.Set(pod.Labels)) &&
+			pod.Status.Phase == apiv1.PodRunning && isReady(pod) {
+			return
+		}
+	}
+
+	// Not one of the Service's pods is up -- every replica was
+	// evicted/OOM-killed/deleted out-of-band.
+	*drifted++
+	d.evict(fsvc)
+	*evicted++
+}
+
+// hasDrifted reports whether pod's observed state no longer matches what
+// fsvc recorded at specialization time: it moved, was OOM-killed, or has
+// restarted.
+func (d *DriftDetector) hasDrifted(fsvc *fscache.FuncSvc, pod *apiv1.Pod) bool {
+	if pod.Status.PodIP != "" && fsvc.Address != "" && pod.Status.PodIP != fsvc.Address {
+		return true
+	}
+	if pod.Status.Phase != apiv1.PodRunning {
+		return true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.RestartCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isReady(pod *apiv1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == apiv1.PodReady {
+			return c.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (d *DriftDetector) evict(fsvc *fscache.FuncSvc) {
+	d.logger.Info("evicting drifted entry", "address", fsvc.Address, "pod", fsvc.PodName)
+	d.fsCache.DeleteByAddress(fsvc.Address)
+	if d.reclaimer != nil {
+		if err := d.reclaimer.ReclaimSlot(fsvc); err != nil {
+			d.logger.Error("error reclaiming slot", "address", fsvc.Address, "error", err)
+		}
+	}
+}
+
+// GetStats returns the most recent reconciliation counters.
+func (d *DriftDetector) GetStats() Stats {
+	d.statsLock.RLock()
+	defer d.statsLock.RUnlock()
+	return d.stats
+}
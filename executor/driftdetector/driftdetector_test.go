@@ -0,0 +1,261 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driftdetector
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/fission/fission/executor/fscache"
+)
+
+type fakeFuncCache struct {
+	entries []*fscache.FuncSvc
+	deleted []string
+}
+
+func (f *fakeFuncCache) ListAll() []*fscache.FuncSvc { return f.entries }
+
+func (f *fakeFuncCache) DeleteByAddress(address string) {
+	f.deleted = append(f.deleted, address)
+}
+
+type fakeReclaimer struct {
+	reclaimed []*fscache.FuncSvc
+}
+
+func (r *fakeReclaimer) ReclaimSlot(fsvc *fscache.FuncSvc) error {
+	r.reclaimed = append(r.reclaimed, fsvc)
+	return nil
+}
+
+// newTestDriftDetector builds a DriftDetector backed by a fake clientset's
+// informers (synced against objs) and a fake funcCache/PoolReclaimer, so
+// reconcile logic can be exercised without a real cluster or fscache.
+func newTestDriftDetector(t *testing.T, namespace string, objs ...runtime.Object) (*DriftDetector, *fakeFuncCache, *fakeReclaimer) {
+	t.Helper()
+
+	client := fake.NewSimpleClientset(objs...)
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0, informers.WithNamespace(namespace))
+	podInformer := factory.Core().V1().Pods().Informer()
+	svcInformer := factory.Core().V1().Services().Informer()
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	go podInformer.Run(stopCh)
+	go svcInformer.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, podInformer.HasSynced, svcInformer.HasSynced) {
+		t.Fatal("informer cache failed to sync")
+	}
+
+	fsCache := &fakeFuncCache{}
+	reclaimer := &fakeReclaimer{}
+	d := &DriftDetector{
+		logger:      hclog.NewNullLogger(),
+		fsCache:     fsCache,
+		reclaimer:   reclaimer,
+		namespace:   namespace,
+		interval:    DefaultInterval,
+		podInformer: podInformer,
+		svcInformer: svcInformer,
+	}
+	return d, fsCache, reclaimer
+}
+
+func readyPod(namespace, name, ip string, labels map[string]string) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			PodIP: ip,
+			Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodReady, Status: apiv1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestHasDrifted(t *testing.T) {
+	d := &DriftDetector{}
+
+	tests := []struct {
+		name string
+		fsvc *fscache.FuncSvc
+		pod  *apiv1.Pod
+		want bool
+	}{
+		{
+			name: "unchanged",
+			fsvc: &fscache.FuncSvc{Address: "10.0.0.1"},
+			pod:  readyPod("ns", "p", "10.0.0.1", nil),
+			want: false,
+		},
+		{
+			name: "moved",
+			fsvc: &fscache.FuncSvc{Address: "10.0.0.1"},
+			pod:  readyPod("ns", "p", "10.0.0.2", nil),
+			want: true,
+		},
+		{
+			name: "not running",
+			fsvc: &fscache.FuncSvc{Address: "10.0.0.1"},
+			pod: &apiv1.Pod{
+				Status: apiv1.PodStatus{Phase: apiv1.PodPending, PodIP: "10.0.0.1"},
+			},
+			want: true,
+		},
+		{
+			name: "restarted",
+			fsvc: &fscache.FuncSvc{Address: "10.0.0.1"},
+			pod: &apiv1.Pod{
+				Status: apiv1.PodStatus{
+					Phase:             apiv1.PodRunning,
+					PodIP:             "10.0.0.1",
+					ContainerStatuses: []apiv1.ContainerStatus{{RestartCount: 1}},
+				},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.hasDrifted(tt.fsvc, tt.pod); got != tt.want {
+				t.Errorf("hasDrifted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileSinglePodEvictsGonePod(t *testing.T) {
+	fsvc := &fscache.FuncSvc{Address: "10.0.0.1", PodName: "missing-pod"}
+	d, fsCache, _ := newTestDriftDetector(t, "fission-function")
+
+	drifted, evicted := 0, 0
+	d.reconcileSinglePod(fsvc, &drifted, &evicted)
+
+	if drifted != 1 || evicted != 1 {
+		t.Errorf("got drifted=%d evicted=%d, want 1, 1", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 1 || fsCache.deleted[0] != fsvc.Address {
+		t.Errorf("got deleted=%v, want [%q]", fsCache.deleted, fsvc.Address)
+	}
+}
+
+func TestReconcileSinglePodLeavesUnchangedPod(t *testing.T) {
+	pod := readyPod("fission-function", "my-pod", "10.0.0.1", nil)
+	fsvc := &fscache.FuncSvc{Address: "10.0.0.1", PodName: "my-pod"}
+	d, fsCache, _ := newTestDriftDetector(t, "fission-function", pod)
+
+	drifted, evicted := 0, 0
+	d.reconcileSinglePod(fsvc, &drifted, &evicted)
+
+	if drifted != 0 || evicted != 0 {
+		t.Errorf("got drifted=%d evicted=%d, want 0, 0", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 0 {
+		t.Errorf("got deleted=%v, want none", fsCache.deleted)
+	}
+}
+
+func TestReconcileSinglePodEvictsMovedPod(t *testing.T) {
+	// Pod is still Running+Ready but its IP no longer matches what was
+	// cached -- there's no call to refresh fsCache's Address in place, so
+	// this must evict rather than touch (see reconcileSinglePod).
+	pod := readyPod("fission-function", "my-pod", "10.0.0.2", nil)
+	fsvc := &fscache.FuncSvc{Address: "10.0.0.1", PodName: "my-pod"}
+	d, fsCache, _ := newTestDriftDetector(t, "fission-function", pod)
+
+	drifted, evicted := 0, 0
+	d.reconcileSinglePod(fsvc, &drifted, &evicted)
+
+	if drifted != 1 || evicted != 1 {
+		t.Errorf("got drifted=%d evicted=%d, want 1, 1", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 1 || fsCache.deleted[0] != fsvc.Address {
+		t.Errorf("got deleted=%v, want [%q]", fsCache.deleted, fsvc.Address)
+	}
+}
+
+func TestReconcileServiceBackedLeavesEntryWithReadyPod(t *testing.T) {
+	selector := map[string]string{"fission-function-deployment": "myfunc-abc123"}
+	svc := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fission-function", Name: "myfunc-abc123"},
+		Spec:       apiv1.ServiceSpec{Selector: selector},
+	}
+	pod := readyPod("fission-function", "myfunc-abc123-xyz", "10.0.0.5", selector)
+	fsvc := &fscache.FuncSvc{Address: "myfunc-abc123.fission-function"}
+
+	d, fsCache, _ := newTestDriftDetector(t, "fission-function", svc, pod)
+
+	drifted, evicted := 0, 0
+	d.reconcileServiceBacked(fsvc, &drifted, &evicted)
+
+	if drifted != 0 || evicted != 0 {
+		t.Errorf("got drifted=%d evicted=%d, want 0, 0", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 0 {
+		t.Errorf("got deleted=%v, want none", fsCache.deleted)
+	}
+}
+
+func TestReconcileServiceBackedEvictsWhenNoPodIsReady(t *testing.T) {
+	selector := map[string]string{"fission-function-deployment": "myfunc-abc123"}
+	svc := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fission-function", Name: "myfunc-abc123"},
+		Spec:       apiv1.ServiceSpec{Selector: selector},
+	}
+	fsvc := &fscache.FuncSvc{Address: "myfunc-abc123.fission-function"}
+
+	d, fsCache, reclaimer := newTestDriftDetector(t, "fission-function", svc)
+
+	drifted, evicted := 0, 0
+	d.reconcileServiceBacked(fsvc, &drifted, &evicted)
+
+	if drifted != 1 || evicted != 1 {
+		t.Errorf("got drifted=%d evicted=%d, want 1, 1", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 1 || fsCache.deleted[0] != fsvc.Address {
+		t.Errorf("got deleted=%v, want [%q]", fsCache.deleted, fsvc.Address)
+	}
+	if len(reclaimer.reclaimed) != 1 {
+		t.Errorf("got reclaimed=%v, want 1 entry", reclaimer.reclaimed)
+	}
+}
+
+func TestReconcileServiceBackedEvictsWhenServiceGone(t *testing.T) {
+	fsvc := &fscache.FuncSvc{Address: "myfunc-abc123.fission-function"}
+	d, fsCache, _ := newTestDriftDetector(t, "fission-function")
+
+	drifted, evicted := 0, 0
+	d.reconcileServiceBacked(fsvc, &drifted, &evicted)
+
+	if drifted != 1 || evicted != 1 {
+		t.Errorf("got drifted=%d evicted=%d, want 1, 1", drifted, evicted)
+	}
+	if len(fsCache.deleted) != 1 {
+		t.Errorf("got deleted=%v, want 1 entry", fsCache.deleted)
+	}
+}
+
@@ -0,0 +1,31 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driftdetector
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ServeHTTP serves the /v1/drift debug endpoint: the detector's current
+// reconciliation stats as JSON.
+func (d *DriftDetector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.GetStats()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
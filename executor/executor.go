@@ -17,31 +17,44 @@ limitations under the License.
 package executor
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"net/http"
 	"os"
-	"sync"
 	"time"
 
 	"github.com/dchest/uniuri"
+	"github.com/hashicorp/go-hclog"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/fission/fission"
 	"github.com/fission/fission/cache"
 	"github.com/fission/fission/crd"
+	"github.com/fission/fission/executor/driftdetector"
 	"github.com/fission/fission/executor/fscache"
-	"github.com/fission/fission/executor/poolmgr"
+	"github.com/fission/fission/executor/logstream"
+	"github.com/fission/fission/executor/singleflight"
 )
 
+// defaultSpecializationTimeout bounds how long a single specialization
+// attempt (the call a Backend's GetFuncSvc makes) is allowed to run
+// before sfGroup cancels it and returns an error to every request
+// coalesced onto it.
+const defaultSpecializationTimeout = 2 * time.Minute
+
 type (
 	Executor struct {
-		gpm           *poolmgr.GenericPoolManager
-		functionEnv   *cache.Cache
+		logger        hclog.Logger
+		backends      map[fission.ExecutorType]Backend
+		envRes        *envResolver
 		fissionClient *crd.FissionClient
 		fsCache       *fscache.FunctionServiceCache
+		sfGroup       *singleflight.Group
 
 		requestChan chan *createFuncServiceRequest
-		fsCreateWg  map[string]*sync.WaitGroup
 	}
 	createFuncServiceRequest struct {
+		ctx      context.Context
 		funcMeta *metav1.ObjectMeta
 		respChan chan *createFuncServiceResponse
 	}
@@ -49,147 +62,276 @@ type (
 	createFuncServiceResponse struct {
 		funcSvc *fscache.FuncSvc
 		err     error
+
+		// requestID is the correlation ID this request's specialization
+		// was logged under; callers should surface it as the
+		// RequestIDHeader response header so router-side traces can be
+		// joined to the executor-side ones.
+		requestID string
+	}
+
+	// envResolver caches Function -> Environment lookups so every
+	// Backend doesn't have to hit the controller on each specialization.
+	envResolver struct {
+		functionEnv   *cache.Cache
+		fissionClient *crd.FissionClient
 	}
 )
 
-func MakeExecutor(gpm *poolmgr.GenericPoolManager, fissionClient *crd.FissionClient, fsCache *fscache.FunctionServiceCache) *Executor {
+// MakeExecutor builds an Executor that routes specialization requests to
+// backends, keyed by fission.ExecutorType. Each function is routed to the
+// backend named by its own InvokeStrategy rather than a single
+// process-wide backend.
+func MakeExecutor(logger hclog.Logger, backends map[fission.ExecutorType]Backend, fissionClient *crd.FissionClient, fsCache *fscache.FunctionServiceCache, sfGroup *singleflight.Group) *Executor {
 	executor := &Executor{
-		gpm:           gpm,
-		functionEnv:   cache.MakeCache(10*time.Second, 0),
+		logger:        logger.Named("executor"),
+		backends:      backends,
+		envRes:        makeEnvResolver(fissionClient),
 		fissionClient: fissionClient,
 		fsCache:       fsCache,
+		sfGroup:       sfGroup,
 
 		requestChan: make(chan *createFuncServiceRequest),
-		fsCreateWg:  make(map[string]*sync.WaitGroup),
 	}
 	go executor.serveCreateFuncServices()
 	return executor
 }
 
-// All non-cached function service requests go through this goroutine
-// serially. It parallelizes requests for different functions, and
-// ensures that for a given function, only one request causes a pod to
-// get specialized. In other words, it ensures that when there's an
-// ongoing request for a certain function, all other requests wait for
-// that request to complete.
-func (executor *Executor) serveCreateFuncServices() {
-	for {
-		req := <-executor.requestChan
-		m := req.funcMeta
-
-		// Cache miss -- is this first one to request the func?
-		wg, found := executor.fsCreateWg[crd.CacheKey(m)]
-		if !found {
-			// create a waitgroup for other requests for
-			// the same function to wait on
-			wg := &sync.WaitGroup{}
-			wg.Add(1)
-			executor.fsCreateWg[crd.CacheKey(m)] = wg
-
-			// launch a goroutine for each request, to parallelize
-			// the specialization of different functions
-			go func() {
-				fsvc, err := executor.createServiceForFunction(m)
-				req.respChan <- &createFuncServiceResponse{
-					funcSvc: fsvc,
-					err:     err,
-				}
-				delete(executor.fsCreateWg, crd.CacheKey(m))
-				wg.Done()
-			}()
-		} else {
-			// There's an existing request for this function, wait for it to finish
-			go func() {
-				log.Printf("Waiting for concurrent request for the same function: %v", m)
-				wg.Wait()
-
-				// get the function service from the cache
-				fsvc, err := executor.fsCache.GetByFunction(m)
-				req.respChan <- &createFuncServiceResponse{
-					funcSvc: fsvc,
-					err:     err,
-				}
-			}()
-		}
-	}
-}
-
-func (executor *Executor) createServiceForFunction(m *metav1.ObjectMeta) (*fscache.FuncSvc, error) {
-	log.Printf("[%v] No cached function service found, creating one", m.Name)
-
-	env, err := executor.getFunctionEnv(m)
-	if err != nil {
-		return nil, err
-	}
-	// Appropriate backend handles the service creation
-	backend := os.Getenv("EXECUTOR_BACKEND")
-	switch backend {
-	case "DEPLOY":
-		return nil, nil
-	default:
-		pool, err := executor.gpm.GetPool(env)
-		if err != nil {
-			return nil, err
-		}
-		// from GenericPool -> get one function container
-		// (this also adds to the cache)
-		log.Printf("[%v] getting function service from pool", m.Name)
-		fsvc, err := pool.GetFuncSvc(m)
-		if err != nil {
-			return nil, err
-		}
-		return fsvc, nil
+func makeEnvResolver(fissionClient *crd.FissionClient) *envResolver {
+	return &envResolver{
+		functionEnv:   cache.MakeCache(10*time.Second, 0),
+		fissionClient: fissionClient,
 	}
 }
 
-func (executor *Executor) getFunctionEnv(m *metav1.ObjectMeta) (*crd.Environment, error) {
+func (r *envResolver) getFunctionEnv(logger hclog.Logger, m *metav1.ObjectMeta) (*crd.Environment, error) {
 	var env *crd.Environment
 
 	// Cached ?
-	result, err := executor.functionEnv.Get(crd.CacheKey(m))
+	result, err := r.functionEnv.Get(crd.CacheKey(m))
 	if err == nil {
 		env = result.(*crd.Environment)
 		return env, nil
 	}
 
 	// Cache miss -- get func from controller
-	f, err := executor.fissionClient.Functions(m.Namespace).Get(m.Name)
+	f, err := r.fissionClient.Functions(m.Namespace).Get(m.Name)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get env from metadata
-	log.Printf("[%v] getting env", m)
-	env, err = executor.fissionClient.Environments(f.Spec.Environment.Namespace).Get(f.Spec.Environment.Name)
+	logger.Debug("getting function environment", "environment", f.Spec.Environment.Name)
+	env, err = r.fissionClient.Environments(f.Spec.Environment.Namespace).Get(f.Spec.Environment.Name)
 	if err != nil {
 		return nil, err
 	}
 
 	// cache for future lookups
-	executor.functionEnv.Set(crd.CacheKey(m), env)
+	r.functionEnv.Set(crd.CacheKey(m), env)
 
 	return env, nil
 }
 
+// All non-cached function service requests go through this goroutine
+// serially. It hands each one off to sfGroup, which parallelizes
+// requests for different functions while ensuring that for a given
+// function, only one request causes a pod to get specialized and every
+// other concurrent requester gets that same attempt's result -- rather
+// than the hand-rolled fsCreateWg map this used to maintain, whose
+// delete raced against callers reading the map on their own goroutine.
+func (executor *Executor) serveCreateFuncServices() {
+	for {
+		req := <-executor.requestChan
+		m := req.funcMeta
+
+		// Every specialization request gets its own short correlation
+		// ID, logged at each stage and handed back to the caller so
+		// router-side 5xx traces can be joined to this one.
+		reqID := uniuri.NewLen(8)
+		logger := executor.logger.With("requestID", reqID, "function", m.Name, "namespace", m.Namespace)
+
+		ctx := req.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		go func() {
+			val, err := executor.sfGroup.Do(ctx, crd.CacheKey(m), func(ctx context.Context) (interface{}, error) {
+				return executor.createServiceForFunction(ctx, logger, m)
+			})
+
+			var fsvc *fscache.FuncSvc
+			if val != nil {
+				fsvc = val.(*fscache.FuncSvc)
+			}
+			req.respChan <- &createFuncServiceResponse{
+				funcSvc:   fsvc,
+				err:       err,
+				requestID: reqID,
+			}
+		}()
+	}
+}
+
+func (executor *Executor) createServiceForFunction(ctx context.Context, logger hclog.Logger, m *metav1.ObjectMeta) (*fscache.FuncSvc, error) {
+	logger.Info("no cached function service found, creating one")
+
+	f, err := executor.fissionClient.Functions(m.Namespace).Get(m.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each function carries its own ExecutorType in its InvokeStrategy,
+	// so the backend is picked per-function rather than process-wide.
+	executorType := f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType
+	if executorType == "" {
+		executorType = fission.ExecutorTypePoolmgr
+	}
+	logger = logger.With("executorType", executorType)
+
+	backend, ok := executor.backends[executorType]
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for executor type %q", executorType)
+	}
+
+	fsvc, err := backend.GetFuncSvc(ctx, logger, m)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tag the cache entry with the backend that owns it, so anything
+	// that later needs to act on an already-cached FuncSvc (TapService,
+	// Cleanup, the drift detector) knows which Backend to route to
+	// without re-deriving it from the function's InvokeStrategy.
+	fsvc.ExecutorType = executorType
+
+	logger.Info("function specialized")
+	return fsvc, nil
+}
+
+// TapService notifies whichever backend owns fsvc that it was just served
+// a request, so that backend can keep fsvc's backing resources warm. The
+// owning backend is resolved from the ExecutorType createServiceForFunction
+// tagged fsvc with at specialization time.
+func (executor *Executor) TapService(fsvc *fscache.FuncSvc) error {
+	backend, ok := executor.backends[fsvc.ExecutorType]
+	if !ok {
+		return fmt.Errorf("no backend registered for executor type %q", fsvc.ExecutorType)
+	}
+	return backend.TapService(fsvc)
+}
+
+// Cleanup tears down whatever resources back fsvc, routed to the same
+// backend that created it.
+func (executor *Executor) Cleanup(fsvc *fscache.FuncSvc) error {
+	backend, ok := executor.backends[fsvc.ExecutorType]
+	if !ok {
+		return fmt.Errorf("no backend registered for executor type %q", fsvc.ExecutorType)
+	}
+	return backend.Cleanup(fsvc)
+}
+
 // StartExecutor Starts executor and the backend components that executor uses such as Poolmgr,
 // deploymgr and potential future backends
 func StartExecutor(fissionNamespace string, functionNamespace string, port int) error {
+	logger := makeLogger("fission-executor")
+
 	fissionClient, kubernetesClient, _, err := crd.MakeFissionClient()
 	if err != nil {
-		log.Printf("Failed to get kubernetes client: %v", err)
+		logger.Error("failed to get kubernetes client", "error", err)
 		return err
 	}
 
 	instanceID := uniuri.NewLen(8)
-	poolmgr.CleanupOldPoolmgrResources(kubernetesClient, functionNamespace, instanceID)
+
+	dynamicClient, err := crd.MakeDynamicClient()
+	if err != nil {
+		logger.Error("failed to get dynamic client", "error", err)
+		return err
+	}
 
 	fsCache := fscache.MakeFunctionServiceCache()
-	gpm := poolmgr.MakeGenericPoolManager(
-		fissionClient, kubernetesClient, fissionNamespace,
-		functionNamespace, fsCache, instanceID)
+	envRes := makeEnvResolver(fissionClient)
+
+	deps := BackendDeps{
+		FissionClient:     fissionClient,
+		KubernetesClient:  kubernetesClient,
+		DynamicClient:     dynamicClient,
+		FissionNamespace:  fissionNamespace,
+		FunctionNamespace: functionNamespace,
+		FsCache:           fsCache,
+		InstanceID:        instanceID,
+		EnvRes:            envRes,
+	}
+
+	cfg := loadExecutorConfig(logger, executorConfigPath())
+	backends, err := buildBackends(logger, deps, cfg.Backends)
+	if err != nil {
+		logger.Error("failed to build backends", "error", err)
+		return err
+	}
+
+	ctx := context.Background()
+	for executorType, b := range backends {
+		if err := b.Start(ctx); err != nil {
+			logger.Error("backend failed to start", "executorType", executorType, "error", err)
+			return err
+		}
+	}
+
+	// The drift detector reclaims slots through poolmgr specifically,
+	// which isn't part of the Backend interface -- fall back to doing
+	// nothing if poolmgr isn't one of the configured backends.
+	var reclaimer driftdetector.PoolReclaimer
+	if b, ok := backends[fission.ExecutorTypePoolmgr]; ok {
+		reclaimer, _ = b.(driftdetector.PoolReclaimer)
+	}
+
+	dd := driftdetector.MakeDriftDetector(logger, kubernetesClient, fsCache, reclaimer, functionNamespace, driftInterval(logger))
+	go dd.Run(make(chan struct{}))
+	http.HandleFunc("/v1/drift", dd.ServeHTTP)
+
+	ls := logstream.MakeLogStreamer(logger, kubernetesClient, fsCache, functionNamespace)
+	http.Handle("/v1/functions/", ls)
 
-	api := MakeExecutor(gpm, fissionClient, fsCache)
+	sfGroup := singleflight.New("specialize", specializationTimeout(logger))
+
+	api := MakeExecutor(logger, backends, fissionClient, fsCache, sfGroup)
 	go api.Serve(port)
 
 	return nil
 }
+
+// specializationTimeout reads SPECIALIZATION_TIMEOUT (a duration string
+// like "2m"), the deadline sfGroup enforces on a single specialization
+// attempt; an unset or unparsable value falls back to
+// defaultSpecializationTimeout.
+func specializationTimeout(logger hclog.Logger) time.Duration {
+	v := os.Getenv("SPECIALIZATION_TIMEOUT")
+	if v == "" {
+		return defaultSpecializationTimeout
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Warn("invalid SPECIALIZATION_TIMEOUT, using default", "value", v, "error", err)
+		return defaultSpecializationTimeout
+	}
+	return d
+}
+
+// driftInterval reads DRIFT_DETECTOR_INTERVAL (a duration string like
+// "30s"); an unset or unparsable value falls back to
+// driftdetector.DefaultInterval.
+func driftInterval(logger hclog.Logger) time.Duration {
+	v := os.Getenv("DRIFT_DETECTOR_INTERVAL")
+	if v == "" {
+		return driftdetector.DefaultInterval
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logger.Warn("invalid DRIFT_DETECTOR_INTERVAL, using default", "value", v, "error", err)
+		return driftdetector.DefaultInterval
+	}
+	return d
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// RequestIDHeader carries a specialization request's correlation ID back
+// to the router, so a 5xx on the router side can be joined to the
+// executor-side trace for the same request.
+const RequestIDHeader = "X-Fission-Request-ID"
+
+// makeLogger builds the executor's root logger. Output is human-readable
+// text by default; setting FISSION_LOG_FORMAT=json switches to JSON lines
+// suitable for ingestion into Loki/ES.
+func makeLogger(name string) hclog.Logger {
+	opts := &hclog.LoggerOptions{
+		Name:   name,
+		Level:  hclog.Info,
+		Output: os.Stderr,
+	}
+	if os.Getenv("FISSION_LOG_FORMAT") == "json" {
+		opts.JSONFormat = true
+	}
+	return hclog.New(opts)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logstream implements the executor's function log streaming
+// endpoint. Rather than `fission fn logs` shelling out to one-shot
+// `kubectl logs`, the executor itself tails the backing pod(s) -- fanning
+// in every ReplicaSet pod for deploy-backed functions -- and keeps a
+// short ring buffer per FuncSvc so a cold-stopped pod's last output isn't
+// lost.
+package logstream
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fission/fission/executor/fscache"
+	"github.com/fission/fission/executor/svcaddr"
+)
+
+// RingBufferSizeKB is the default amount of log output retained per
+// FuncSvc once its pods are gone.
+const RingBufferSizeKB = 128
+
+// reconnectBackoff is how long we wait before re-resolving a
+// follow-mode stream's backing pods after all of them have stopped
+// producing logs -- the case where a pod was replaced mid-stream.
+const reconnectBackoff = 2 * time.Second
+
+// LogStreamer serves GET /v1/functions/{ns}/{name}/logs, tailing every pod
+// backing the function and multiplexing their output to the caller.
+type LogStreamer struct {
+	logger           hclog.Logger
+	kubernetesClient *kubernetes.Clientset
+	fsCache          *fscache.FunctionServiceCache
+	namespace        string
+
+	buffersLock sync.Mutex
+	buffers     map[string]*ringBuffer
+}
+
+// MakeLogStreamer builds a LogStreamer scoped to the executor's function
+// namespace, the same namespace poolmgr and deploymgr operate in.
+func MakeLogStreamer(logger hclog.Logger, kubernetesClient *kubernetes.Clientset, fsCache *fscache.FunctionServiceCache, namespace string) *LogStreamer {
+	return &LogStreamer{
+		logger:           logger.Named("logstream"),
+		kubernetesClient: kubernetesClient,
+		fsCache:          fsCache,
+		namespace:        namespace,
+		buffers:          make(map[string]*ringBuffer),
+	}
+}
+
+// ServeHTTP handles GET /v1/functions/{ns}/{name}/logs?follow=&container=&since=&tailLines=.
+func (ls *LogStreamer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ns, name, ok := parseFunctionLogsPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Keyed by function identity, not by the backing FuncSvc's address:
+	// the address is a pod IP for poolmgr-backed functions and changes
+	// on every respecialization, so keying by it would orphan a new
+	// buffer per cold-start cycle and never let the function's prior
+	// output be found again.
+	buf := ls.bufferFor(fmt.Sprintf("%v/%v", ns, name))
+	opts := parseLogOptions(r)
+
+	fsvc, err := ls.fsCache.GetByFunction(&metav1.ObjectMeta{Namespace: ns, Name: name})
+	if err != nil {
+		if opts.Follow {
+			http.Error(w, fmt.Sprintf("no running instance of function %v/%v: %v", ns, name, err), http.StatusNotFound)
+			return
+		}
+		// Cold-stopped (or never specialized) -- the only thing left
+		// to offer a non-following caller is whatever this function's
+		// pods wrote before they went away.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	flusher, canFlush := w.(http.Flusher)
+	var writeLock sync.Mutex
+
+	for {
+		pods, err := ls.backingPods(fsvc)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(pods) == 0 {
+			if !opts.Follow {
+				// The function has already cold-stopped; all we can
+				// offer is whatever was captured before it went away.
+				_, _ = w.Write(buf.Bytes())
+				return
+			}
+			if r.Context().Err() != nil {
+				return
+			}
+			time.Sleep(reconnectBackoff)
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, podName := range pods {
+			wg.Add(1)
+			go func(podName string) {
+				defer wg.Done()
+				ls.streamPod(r, w, &writeLock, flusher, canFlush, podName, opts, buf)
+			}(podName)
+		}
+		wg.Wait()
+
+		// Every pod's stream ended. If the caller isn't following, or
+		// gave up, we're done; otherwise a pod was likely replaced
+		// (e.g. by the drift detector) -- re-resolve and keep going.
+		if !opts.Follow || r.Context().Err() != nil {
+			return
+		}
+		time.Sleep(reconnectBackoff)
+	}
+}
+
+// streamPod opens the pod's log subresource and copies each line to w,
+// prefixed with "pod=<name>" so a multi-pod fan-in stream stays
+// attributable, and into buf so the output survives pod termination.
+func (ls *LogStreamer) streamPod(r *http.Request, w http.ResponseWriter, writeLock *sync.Mutex,
+	flusher http.Flusher, canFlush bool, podName string, opts *apiv1.PodLogOptions, buf *ringBuffer) {
+
+	req := ls.kubernetesClient.CoreV1().Pods(ls.namespace).GetLogs(podName, opts)
+	stream, err := req.Stream()
+	if err != nil {
+		ls.logger.Error("error opening log stream", "pod", podName, "error", err)
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		select {
+		case <-r.Context().Done():
+			return
+		default:
+		}
+
+		line := fmt.Sprintf("pod=%v %s\n", podName, scanner.Bytes())
+
+		buf.Write([]byte(line))
+
+		writeLock.Lock()
+		_, werr := w.Write([]byte(line))
+		if werr == nil && canFlush {
+			flusher.Flush()
+		}
+		writeLock.Unlock()
+
+		if werr != nil {
+			return
+		}
+	}
+}
+
+// backingPods resolves the live pod(s) for fsvc: the single specialized
+// pod for poolmgr-backed functions, or every pod selected by the
+// deploymgr-created Service for deploy-backed ones.
+func (ls *LogStreamer) backingPods(fsvc *fscache.FuncSvc) ([]string, error) {
+	if fsvc.PodName != "" {
+		pod, err := ls.kubernetesClient.CoreV1().Pods(ls.namespace).Get(fsvc.PodName, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil
+		}
+		return []string{pod.Name}, nil
+	}
+
+	svcName, svcNamespace := svcaddr.Split(fsvc.Address, ls.namespace)
+	svc, err := ls.kubernetesClient.CoreV1().Services(svcNamespace).Get(svcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil
+	}
+
+	podList, err := ls.kubernetesClient.CoreV1().Pods(svcNamespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(podList.Items))
+	for _, p := range podList.Items {
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
+
+// bufferFor returns the ring buffer for a "<namespace>/<name>" function
+// key, creating it on first use.
+func (ls *LogStreamer) bufferFor(key string) *ringBuffer {
+	ls.buffersLock.Lock()
+	defer ls.buffersLock.Unlock()
+
+	buf, ok := ls.buffers[key]
+	if !ok {
+		buf = newRingBuffer(RingBufferSizeKB)
+		ls.buffers[key] = buf
+	}
+	return buf
+}
+
+func parseLogOptions(r *http.Request) *apiv1.PodLogOptions {
+	q := r.URL.Query()
+	opts := &apiv1.PodLogOptions{
+		Follow:    q.Get("follow") == "true",
+		Container: q.Get("container"),
+	}
+	if tail, err := strconv.ParseInt(q.Get("tailLines"), 10, 64); err == nil {
+		opts.TailLines = &tail
+	}
+	if since, err := strconv.ParseInt(q.Get("since"), 10, 64); err == nil {
+		opts.SinceSeconds = &since
+	}
+	return opts
+}
+
+// parseFunctionLogsPath extracts {ns} and {name} from
+// /v1/functions/{ns}/{name}/logs.
+func parseFunctionLogsPath(path string) (ns string, name string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 5 || parts[0] != "v1" || parts[1] != "functions" || parts[4] != "logs" {
+		return "", "", false
+	}
+	return parts[2], parts[3], true
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logstream
+
+import "sync"
+
+// ringBuffer keeps the last capacity bytes written to it, so a short-lived
+// specialized pod's logs survive long enough for a client to ask for them
+// after the pod has already been cold-stopped.
+type ringBuffer struct {
+	lock     sync.Mutex
+	data     []byte
+	capacity int
+}
+
+func newRingBuffer(capacityKB int) *ringBuffer {
+	return &ringBuffer{
+		capacity: capacityKB * 1024,
+	}
+}
+
+func (r *ringBuffer) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.data = append(r.data, p...)
+	if len(r.data) > r.capacity {
+		r.data = r.data[len(r.data)-r.capacity:]
+	}
+	return len(p), nil
+}
+
+func (r *ringBuffer) Bytes() []byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	out := make([]byte, len(r.data))
+	copy(out, r.data)
+	return out
+}
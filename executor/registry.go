@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/fission/fission"
+	"github.com/fission/fission/crd"
+	"github.com/fission/fission/executor/fscache"
+)
+
+// BackendDeps are the shared handles every backend factory needs, built
+// once in StartExecutor and passed to whichever backends the active
+// config enables.
+type BackendDeps struct {
+	FissionClient     *crd.FissionClient
+	KubernetesClient  *kubernetes.Clientset
+	DynamicClient     dynamic.Interface
+	FissionNamespace  string
+	FunctionNamespace string
+	FsCache           *fscache.FunctionServiceCache
+	InstanceID        string
+	EnvRes            *envResolver
+}
+
+// BackendConfig is one entry of the "backends" list in executor.yaml.
+type BackendConfig struct {
+	// Name is the key a backend was registered under via Register, e.g.
+	// "poolmgr" or "deploy".
+	Name string `yaml:"name"`
+
+	// ExecutorType is the fission.ExecutorType this backend is invoked
+	// for; it need not match Name, so a community backend can be
+	// registered under its own ExecutorType without touching fission's
+	// own type constants.
+	ExecutorType string `yaml:"executorType"`
+
+	Enabled bool `yaml:"enabled"`
+
+	// Params is opaque, backend-specific configuration -- a pool size,
+	// a runtime class, whatever the backend's factory needs that
+	// BackendDeps doesn't already carry.
+	Params map[string]interface{} `yaml:"params"`
+}
+
+// BackendFactory builds a Backend from shared deps and its config entry.
+// Backends register one of these with Register, typically from an init()
+// in the file that defines them.
+type BackendFactory func(logger hclog.Logger, deps BackendDeps, cfg BackendConfig) (Backend, error)
+
+var (
+	registryLock sync.Mutex
+	registry     = make(map[string]BackendFactory)
+)
+
+// Register makes a backend factory available under name for use in
+// executor.yaml. It's meant to be called from an init() function, the same
+// way database/sql drivers register themselves; calling it twice for the
+// same name is a programming error and panics.
+func Register(name string, factory BackendFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("executor: backend %q already registered", name))
+	}
+	registry[name] = factory
+}
+
+// buildBackends instantiates every enabled entry in cfgs, keyed by the
+// fission.ExecutorType it handles.
+func buildBackends(logger hclog.Logger, deps BackendDeps, cfgs []BackendConfig) (map[fission.ExecutorType]Backend, error) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	backends := make(map[fission.ExecutorType]Backend, len(cfgs))
+	for _, cfg := range cfgs {
+		if !cfg.Enabled {
+			continue
+		}
+
+		factory, ok := registry[cfg.Name]
+		if !ok {
+			return nil, fmt.Errorf("no backend registered under name %q", cfg.Name)
+		}
+
+		backend, err := factory(logger, deps, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error building backend %q: %v", cfg.Name, err)
+		}
+		backends[fission.ExecutorType(cfg.ExecutorType)] = backend
+	}
+	return backends, nil
+}
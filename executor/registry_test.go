@@ -0,0 +1,114 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/fission/fission"
+	"github.com/fission/fission/executor/fscache"
+)
+
+type fakeBackend struct{}
+
+func (fakeBackend) Start(ctx context.Context) error       { return nil }
+func (fakeBackend) Stop(ctx context.Context) error        { return nil }
+func (fakeBackend) HealthCheck(ctx context.Context) error { return nil }
+func (fakeBackend) GetFuncSvc(ctx context.Context, logger hclog.Logger, m *metav1.ObjectMeta) (*fscache.FuncSvc, error) {
+	return nil, nil
+}
+func (fakeBackend) TapService(fsvc *fscache.FuncSvc) error { return nil }
+func (fakeBackend) Cleanup(fsvc *fscache.FuncSvc) error    { return nil }
+
+func fakeFactory(logger hclog.Logger, deps BackendDeps, cfg BackendConfig) (Backend, error) {
+	return fakeBackend{}, nil
+}
+
+func TestRegisterPanicsOnDuplicateName(t *testing.T) {
+	name := t.Name()
+	Register(name, fakeFactory)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Register to panic on a duplicate name")
+		}
+	}()
+	Register(name, fakeFactory)
+}
+
+func TestBuildBackendsSkipsDisabledEntries(t *testing.T) {
+	name := t.Name()
+	called := false
+	Register(name, func(logger hclog.Logger, deps BackendDeps, cfg BackendConfig) (Backend, error) {
+		called = true
+		return fakeBackend{}, nil
+	})
+
+	backends, err := buildBackends(hclog.NewNullLogger(), BackendDeps{}, []BackendConfig{
+		{Name: name, ExecutorType: "test-type", Enabled: false},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(backends) != 0 || called {
+		t.Errorf("got %d backends (factory called: %v), want 0 and false for a disabled entry", len(backends), called)
+	}
+}
+
+func TestBuildBackendsKeysByExecutorType(t *testing.T) {
+	name := t.Name()
+	Register(name, fakeFactory)
+
+	backends, err := buildBackends(hclog.NewNullLogger(), BackendDeps{}, []BackendConfig{
+		{Name: name, ExecutorType: "test-type", Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := backends[fission.ExecutorType("test-type")]; !ok {
+		t.Errorf("got %v, want a backend keyed by ExecutorType %q", backends, "test-type")
+	}
+}
+
+func TestBuildBackendsErrorsOnUnknownName(t *testing.T) {
+	_, err := buildBackends(hclog.NewNullLogger(), BackendDeps{}, []BackendConfig{
+		{Name: "does-not-exist-" + t.Name(), ExecutorType: "test-type", Enabled: true},
+	})
+	if err == nil {
+		t.Error("expected an error for an unregistered backend name")
+	}
+}
+
+func TestBuildBackendsPropagatesFactoryError(t *testing.T) {
+	name := t.Name()
+	wantErr := errors.New("boom")
+	Register(name, func(logger hclog.Logger, deps BackendDeps, cfg BackendConfig) (Backend, error) {
+		return nil, wantErr
+	})
+
+	_, err := buildBackends(hclog.NewNullLogger(), BackendDeps{}, []BackendConfig{
+		{Name: name, ExecutorType: "test-type", Enabled: true},
+	})
+	if err == nil {
+		t.Error("expected buildBackends to propagate the factory's error")
+	}
+}
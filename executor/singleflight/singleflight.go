@@ -0,0 +1,214 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package singleflight coalesces concurrent callers working on the same
+// key into a single in-flight attempt, the way Executor's hand-rolled
+// fsCreateWg map used to for function specialization -- but with context
+// cancellation, a per-call timeout, and panic safety that the map never
+// had.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Result is what a Do call (or the attempt it coalesced onto) produced.
+type Result struct {
+	Val interface{}
+	Err error
+}
+
+// call tracks a single in-flight (or just-completed) attempt for a key.
+type call struct {
+	key    string
+	wg     sync.WaitGroup
+	result Result
+}
+
+// request is how Do hands work to the serving goroutine.
+type request struct {
+	ctx      context.Context
+	key      string
+	fn       func(ctx context.Context) (interface{}, error)
+	respChan chan Result
+}
+
+// Group coalesces concurrent Do calls for the same key. All map access
+// happens on a single serving goroutine, including the delete that used
+// to race against the reader in the old fsCreateWg implementation --
+// completed calls are deleted via a channel back to that same goroutine,
+// never from the attempt's own goroutine.
+type Group struct {
+	timeout time.Duration
+
+	reqChan  chan *request
+	doneChan chan string
+
+	calls map[string]*call
+
+	inflight  prometheus.Gauge
+	coalesced prometheus.Counter
+	timeouts  prometheus.Counter
+}
+
+// New builds a Group. A zero timeout means attempts never time out on
+// their own (they still respect the caller's ctx).
+func New(name string, timeout time.Duration) *Group {
+	g := &Group{
+		timeout:  timeout,
+		reqChan:  make(chan *request),
+		doneChan: make(chan string),
+		calls:    make(map[string]*call),
+
+		inflight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "fission_executor_singleflight_inflight",
+			Help: "Number of in-flight singleflight calls, by group",
+			ConstLabels: prometheus.Labels{
+				"group": name,
+			},
+		}),
+		coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "fission_executor_singleflight_coalesced_total",
+			Help: "Number of calls that coalesced onto an existing in-flight attempt",
+			ConstLabels: prometheus.Labels{
+				"group": name,
+			},
+		}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "fission_executor_singleflight_timeout_total",
+			Help: "Number of in-flight attempts that were cancelled for exceeding their timeout",
+			ConstLabels: prometheus.Labels{
+				"group": name,
+			},
+		}),
+	}
+
+	prometheus.MustRegister(g.inflight, g.coalesced, g.timeouts)
+
+	go g.serve()
+	return g
+}
+
+// Do runs fn for key, or waits for an already in-flight call for the same
+// key to finish and returns its result. It returns early with ctx's error
+// if ctx is cancelled before a result is available.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	req := &request{
+		ctx:      ctx,
+		key:      key,
+		fn:       fn,
+		respChan: make(chan Result, 1),
+	}
+
+	select {
+	case g.reqChan <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-req.respChan:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// serve is the only goroutine that ever reads or writes g.calls.
+func (g *Group) serve() {
+	for {
+		select {
+		case req := <-g.reqChan:
+			c, found := g.calls[req.key]
+			if !found {
+				c = &call{key: req.key}
+				c.wg.Add(1)
+				g.calls[req.key] = c
+				g.inflight.Inc()
+				go g.run(req, c)
+			} else {
+				g.coalesced.Inc()
+				go g.follow(req, c)
+			}
+		case key := <-g.doneChan:
+			delete(g.calls, key)
+			g.inflight.Dec()
+		}
+	}
+}
+
+// run executes fn for the first caller for a key, then reports the result
+// both to that caller and to every follower waiting on c.wg. If the
+// timeout fires before fn returns, callers are released right away with
+// ctx's error, but the key is deliberately kept in g.calls until fn
+// itself finishes: fn may be wrapping a call that doesn't accept a
+// context and so can't actually be aborted (e.g. poolmgr's
+// pool.GetFuncSvc), and freeing the key early would let a fresh Do for
+// the same key start a second, independent attempt racing the abandoned
+// one -- both fighting over the same cache slot, one of them leaking
+// whatever it creates. Any caller that shows up while the key is still
+// claimed coalesces onto this same abandoned call instead.
+func (g *Group) run(req *request, c *call) {
+	ctx := req.ctx
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	resChan := make(chan Result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resChan <- Result{Err: fmt.Errorf("panic in singleflight call for %q: %v", req.key, r)}
+			}
+		}()
+		val, err := req.fn(ctx)
+		resChan <- Result{Val: val, Err: err}
+	}()
+
+	select {
+	case res := <-resChan:
+		c.result = res
+		req.respChan <- c.result
+		c.wg.Done()
+		g.doneChan <- req.key
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			g.timeouts.Inc()
+		}
+		c.result = Result{Err: ctx.Err()}
+		req.respChan <- c.result
+		c.wg.Done()
+		go func() {
+			<-resChan
+			g.doneChan <- req.key
+		}()
+	}
+}
+
+// follow waits for an already-running call to finish and relays its
+// result. It's a plain WaitGroup wait, so a follower whose own ctx is
+// cancelled still returns promptly via Do's second select.
+func (g *Group) follow(req *request, c *call) {
+	c.wg.Wait()
+	req.respChan <- c.result
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package singleflight
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoCoalescesConcurrentCallers(t *testing.T) {
+	g := New(t.Name(), 0)
+
+	var calls int32
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return "result", nil
+	}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([]interface{}, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = g.Do(context.Background(), "key", fn)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("caller %d: unexpected error: %v", i, err)
+		}
+		if results[i] != "result" {
+			t.Errorf("caller %d: got %v, want %q", i, results[i], "result")
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn called %d times, want 1", got)
+	}
+}
+
+func TestDoReturnsCallerContextErrorWithoutWaitingForCall(t *testing.T) {
+	g := New(t.Name(), 0)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	// Get an attempt in flight for "key" that won't finish on its own.
+	go g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		<-block
+		return nil, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := g.Do(ctx, "key", func(ctx context.Context) (interface{}, error) {
+		t.Fatal("fn should not run for a follower whose context is already gone")
+		return nil, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got err %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Do took %v to return after its context expired", elapsed)
+	}
+}
+
+func TestDoTimesOutInFlightAttempt(t *testing.T) {
+	g := New(t.Name(), 20*time.Millisecond)
+
+	_, err := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got err %v, want context.DeadlineExceeded", err)
+	}
+
+	// The key should be free for a fresh attempt once the abandoned fn
+	// actually returns, not wedged forever -- but it's not guaranteed to
+	// be free the instant Do returns to the timed-out caller, since fn
+	// itself is released a moment later. Give it a beat to finish.
+	time.Sleep(50 * time.Millisecond)
+
+	val, err := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "ok", nil
+	})
+	if err != nil || val != "ok" {
+		t.Errorf("got (%v, %v), want (\"ok\", nil)", val, err)
+	}
+}
+
+func TestDoKeepsKeyClaimedUntilAbandonedCallFinishes(t *testing.T) {
+	g := New(t.Name(), 20*time.Millisecond)
+
+	var secondFnCalls int32
+	release := make(chan struct{})
+
+	_, err := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done() // times out and releases the caller...
+		<-release    // ...but fn itself keeps running until told to stop.
+		return "first", nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("got err %v, want context.DeadlineExceeded", err)
+	}
+
+	// A caller showing up while the first attempt is still abandoned
+	// (not yet finished) must coalesce onto it, not start a second,
+	// independent attempt that would race the first over the same key.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, _ = g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&secondFnCalls, 1)
+			return "second", nil
+		})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&secondFnCalls); got != 0 {
+		t.Errorf("second caller's fn ran %d times while the key was still claimed by an abandoned call, want 0", got)
+	}
+}
+
+func TestDoRecoversPanicInCall(t *testing.T) {
+	g := New(t.Name(), 0)
+
+	_, err := g.Do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Errorf("got err %v, want an error mentioning the panic", err)
+	}
+}
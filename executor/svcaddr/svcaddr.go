@@ -0,0 +1,35 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package svcaddr parses the Address a deploy-backed fscache.FuncSvc
+// records. deploymgr builds that Address as "<service>.<namespace>" (see
+// deploymgr.GetFuncSvc); logstream and driftdetector both need to recover
+// the Service name/namespace from it to resolve the pods currently
+// backing it, so the parser lives here instead of being copied into each.
+package svcaddr
+
+import "strings"
+
+// Split splits a deploymgr FuncSvc's "<service>.<namespace>" Address,
+// falling back to defaultNamespace for an address with no namespace
+// component.
+func Split(address, defaultNamespace string) (name, namespace string) {
+	parts := strings.SplitN(address, ".", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return address, defaultNamespace
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2016 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package svcaddr
+
+import "testing"
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name          string
+		address       string
+		defaultNS     string
+		wantSvc       string
+		wantNamespace string
+	}{
+		{"namespaced", "myfunc-abc123.fission-function", "default", "myfunc-abc123", "fission-function"},
+		{"no namespace component", "myfunc-abc123", "fission-function", "myfunc-abc123", "fission-function"},
+		{"empty", "", "fission-function", "", "fission-function"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSvc, gotNS := Split(tt.address, tt.defaultNS)
+			if gotSvc != tt.wantSvc || gotNS != tt.wantNamespace {
+				t.Errorf("Split(%q, %q) = (%q, %q), want (%q, %q)",
+					tt.address, tt.defaultNS, gotSvc, gotNS, tt.wantSvc, tt.wantNamespace)
+			}
+		})
+	}
+}